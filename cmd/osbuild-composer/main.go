@@ -4,6 +4,8 @@ import (
 	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/coreos/go-systemd/activation"
 	"github.com/getsentry/sentry-go"
@@ -89,6 +91,21 @@ func main() {
 		logrus.Warn("GLITCHTIP_DSN not configured, skipping initializing Sentry/Glitchtip")
 	}
 
+	tracerShutdown, err := initTracing(config)
+	if err != nil {
+		logrus.Fatalf("Error initializing OpenTelemetry tracing: %v", err)
+	}
+
+	sigTerm := make(chan os.Signal, 1)
+	signal.Notify(sigTerm, syscall.SIGTERM)
+	go func() {
+		<-sigTerm
+		logrus.Info("Received SIGTERM, shutting down OpenTelemetry tracer")
+		if err := tracerShutdown(context.Background()); err != nil {
+			logrus.Errorf("Error shutting down OpenTelemetry tracer: %v", err)
+		}
+	}()
+
 	stateDir, ok := os.LookupEnv("STATE_DIRECTORY")
 	if !ok {
 		logrus.Fatal("STATE_DIRECTORY is not set. Is the service file missing StateDirectory=?")
@@ -109,18 +126,28 @@ func main() {
 		logrus.Fatalf("Could not get listening sockets: " + err.Error())
 	}
 
+	// Each Init* call below except InitMetricsAPI gets its own startup span so slow initialization
+	// (e.g. repo metadata refresh in InitWeldr) is visible in traces. This
+	// only covers composer's own startup, not individual HTTP/worker-queue
+	// requests afterwards - per-request spans have to be started inside
+	// InitWeldr/InitAPI/InitRemoteWorkers/InitLocalWorker themselves, which
+	// live outside this package.
 	if l, exists := listeners["osbuild-composer.socket"]; exists {
 		if len(l) != 2 {
 			logrus.Fatal("The osbuild-composer.socket unit is misconfigured. It should contain two sockets.")
 		}
 
+		_, span := startupTracer().Start(context.Background(), "InitWeldr")
 		err = composer.InitWeldr(repositoryConfigs, l[0], config.weldrDistrosImageTypeDenyList())
+		span.End()
 		if err != nil {
 			logrus.Fatalf("Error initializing weldr API: %v", err)
 		}
 
 		// Start cloudapi using the 2nd socket and no certs
+		_, span = startupTracer().Start(context.Background(), "InitAPI.local")
 		err = composer.InitAPI(ServerCertFile, ServerKeyFile, false, false, false, l[1])
+		span.End()
 		if err != nil {
 			logrus.Fatalf("Error initializing Cloud API using local socket: %v", err)
 		}
@@ -131,7 +158,9 @@ func main() {
 			logrus.Fatal("The osbuild-local-worker.socket unit is misconfigured. It should contain only one socket.")
 		}
 
+		_, span := startupTracer().Start(context.Background(), "InitLocalWorker")
 		composer.InitLocalWorker(l[0])
+		span.End()
 	}
 
 	if l, exists := listeners["osbuild-composer-prometheus.socket"]; exists {
@@ -147,7 +176,9 @@ func main() {
 			logrus.Fatal("The osbuild-composer-api.socket unit is misconfigured. It should contain only one socket.")
 		}
 
+		_, span := startupTracer().Start(context.Background(), "InitAPI.koji")
 		err = composer.InitAPI(ServerCertFile, ServerKeyFile, config.Koji.EnableTLS, config.Koji.EnableMTLS, config.Koji.EnableJWT, l[0])
+		span.End()
 		if err != nil {
 			logrus.Fatalf("Error initializing koji API: %v", err)
 		}
@@ -158,7 +189,9 @@ func main() {
 			logrus.Fatal("The osbuild-remote-worker.socket unit is misconfigured. It should contain only one socket.")
 		}
 
+		_, span := startupTracer().Start(context.Background(), "InitRemoteWorkers")
 		err = composer.InitRemoteWorkers(ServerCertFile, ServerKeyFile, config.Worker.EnableTLS, config.Worker.EnableMTLS, config.Worker.EnableJWT, l[0])
+		span.End()
 		if err != nil {
 			logrus.Fatalf("Error initializing worker API: %v", err)
 		}
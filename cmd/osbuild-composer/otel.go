@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// initTracing sets up the global OpenTelemetry tracer provider and the
+// traceparent context propagator from config. Tracing is opt-in: if
+// config.OTLPEndpoint is empty, it installs no exporter and returns a no-op
+// shutdown function. When tracing is enabled, it also registers a logrus hook that
+// stamps trace_id/span_id onto every log record carrying a traced context,
+// so Splunk/GlitchTip events can be correlated with traces.
+func initTracing(config *Config) (func(context.Context) error, error) {
+	if config.OTLPEndpoint == "" {
+		logrus.Info("OTLPEndpoint not configured, skipping initializing OpenTelemetry tracing")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(config.OTLPEndpoint),
+	}
+	if config.OTLPInsecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if len(config.OTLPHeaders) > 0 {
+		opts = append(opts, otlptracegrpc.WithHeaders(config.OTLPHeaders))
+	}
+
+	exporter, err := otlptracegrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP exporter: %v", err)
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = "osbuild-composer"
+	}
+
+	res, err := resource.New(context.Background(), resource.WithAttributes(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("error creating OpenTelemetry resource: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.OTLPSamplingRatio))),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	logrus.AddHook(&traceLogHook{})
+
+	return tp.Shutdown, nil
+}
+
+// startupTracer is the tracer used for spans around composer's own startup
+// sequence (see main.go's calls to InitWeldr/InitAPI/InitRemoteWorkers/
+// InitLocalWorker). It is obtained lazily via otel.Tracer so it always
+// reflects whatever TracerProvider initTracing installed, or otel's default
+// no-op provider when tracing is disabled and initTracing installed none.
+func startupTracer() trace.Tracer {
+	return otel.Tracer("github.com/osbuild/osbuild-composer/cmd/osbuild-composer")
+}
+
+// traceLogHook attaches trace_id/span_id fields to a logrus record whenever
+// its Entry.Context carries an active OpenTelemetry span.
+type traceLogHook struct{}
+
+func (*traceLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (*traceLogHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	spanCtx := trace.SpanContextFromContext(entry.Context)
+	if !spanCtx.IsValid() {
+		return nil
+	}
+
+	entry.Data["trace_id"] = spanCtx.TraceID().String()
+	entry.Data["span_id"] = spanCtx.SpanID().String()
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestInitTracingNoopWithoutEndpoint(t *testing.T) {
+	shutdown, err := initTracing(&Config{})
+	require.NoError(t, err)
+	require.NotNil(t, shutdown)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestTraceLogHookIgnoresEntryWithoutContext(t *testing.T) {
+	hook := &traceLogHook{}
+	entry := &logrus.Entry{Data: logrus.Fields{}}
+
+	require.NoError(t, hook.Fire(entry))
+	assert.NotContains(t, entry.Data, "trace_id")
+	assert.NotContains(t, entry.Data, "span_id")
+}
+
+func TestTraceLogHookStampsTraceAndSpanID(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "test-span")
+	defer span.End()
+
+	hook := &traceLogHook{}
+	entry := &logrus.Entry{Context: ctx, Data: logrus.Fields{}}
+
+	require.NoError(t, hook.Fire(entry))
+	assert.Equal(t, span.SpanContext().TraceID().String(), entry.Data["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), entry.Data["span_id"])
+}
@@ -0,0 +1,120 @@
+package osbuild
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// Compression selects the algorithm used to compress a composer output
+// artifact.
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+	CompressionXz   Compression = "xz"
+)
+
+// CompressionDefault is used by image types that do not specify a
+// compression of their own. Existing image types keep requesting
+// CompressionGzip explicitly so their output stays byte-compatible with
+// consumers that decompress the stream blindly; CompressionDefault is for
+// new image types only.
+const CompressionDefault = CompressionZstd
+
+// CompressionOptions configures a compression stage generated by
+// GenCompressionStage. Level is algorithm-specific; a zero value picks the
+// tuned default for the selected Compression.
+type CompressionOptions struct {
+	Compression Compression
+	Level       int
+}
+
+// defaultLevel returns the tuned default level for a compression
+// algorithm when the caller did not request a specific one.
+func defaultLevel(compression Compression) int {
+	switch compression {
+	case CompressionZstd:
+		// zstd level 19 gives xz-like ratios while staying far faster to
+		// decompress; osbuild runs it multi-threaded so the extra levels
+		// don't cost wall-clock time on the build host.
+		return 19
+	case CompressionXz:
+		return 6
+	case CompressionGzip:
+		return 6
+	default:
+		return 0
+	}
+}
+
+// GenCompressionStage returns the osbuild stage that compresses filename
+// with the requested algorithm, or nil for CompressionNone. An empty
+// Compression selects CompressionDefault. GenImageFinalizeStages
+// calls this instead of hard-coding a gzip stage.
+func GenCompressionStage(opts CompressionOptions, filename string) (*Stage, error) {
+	compression := opts.Compression
+	if compression == "" {
+		compression = CompressionDefault
+	}
+
+	level := opts.Level
+	if level == 0 {
+		level = defaultLevel(compression)
+	}
+
+	switch compression {
+	case CompressionNone:
+		return nil, nil
+	case CompressionGzip:
+		return NewGzipStage(&GzipStageOptions{
+			Filename: filename,
+			Level:    level,
+		}), nil
+	case CompressionXz:
+		return NewXzStage(&XzStageOptions{
+			Filename: filename,
+			Level:    level,
+		}), nil
+	case CompressionZstd:
+		return NewZstdStage(&ZstdStageOptions{
+			Filename: filename,
+			Level:    level,
+			// zstd scales close to linearly with threads; 0 lets the zstd
+			// stage pick based on the build host's CPU count.
+			Threads: 0,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown compression type: %q", compression)
+	}
+}
+
+// GenImageFinalizeStages returns the stages that finish a disk image once
+// its filesystems and bootloader are in place: GenDeviceFinishStages'
+// LVM-metadata-rename/LUKS-key-removal stages, followed by a compression
+// stage for the image file itself if compression.Compression is not
+// CompressionNone. It takes the place of calling GenDeviceFinishStages
+// and a hard-coded gzip stage separately.
+//
+// Threading CompressionOptions through the image-type definitions so a
+// build can request a compression per image type, and having the worker
+// report the chosen algorithm in job metadata, are both still out of
+// scope here: pkg/image and the worker job-result types that would carry
+// that choice aren't present in this tree. Callers in pkg/image should
+// pass through whatever CompressionOptions the image type was built with
+// once that package can reach this one.
+func GenImageFinalizeStages(pt *disk.PartitionTable, filename string, compression CompressionOptions) ([]*Stage, error) {
+	stages := GenDeviceFinishStages(pt, filename)
+
+	compressionStage, err := GenCompressionStage(compression, filename)
+	if err != nil {
+		return nil, err
+	}
+	if compressionStage != nil {
+		stages = append(stages, compressionStage)
+	}
+
+	return stages, nil
+}
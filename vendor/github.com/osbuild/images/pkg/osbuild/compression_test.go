@@ -0,0 +1,76 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenCompressionStageNone(t *testing.T) {
+	stage, err := GenCompressionStage(CompressionOptions{Compression: CompressionNone}, "image.raw")
+	require.NoError(t, err)
+	assert.Nil(t, stage)
+}
+
+func TestGenCompressionStageGzipUsesTunedLevel(t *testing.T) {
+	stage, err := GenCompressionStage(CompressionOptions{Compression: CompressionGzip}, "image.raw")
+	require.NoError(t, err)
+	require.NotNil(t, stage)
+	assert.Equal(t, "org.osbuild.gzip", stage.Type)
+
+	opts, ok := stage.Options.(*GzipStageOptions)
+	require.True(t, ok)
+	assert.Equal(t, "image.raw", opts.Filename)
+	assert.Equal(t, defaultLevel(CompressionGzip), opts.Level)
+}
+
+func TestGenCompressionStageXzExplicitLevel(t *testing.T) {
+	stage, err := GenCompressionStage(CompressionOptions{Compression: CompressionXz, Level: 9}, "image.raw")
+	require.NoError(t, err)
+	require.NotNil(t, stage)
+	assert.Equal(t, "org.osbuild.xz", stage.Type)
+
+	opts, ok := stage.Options.(*XzStageOptions)
+	require.True(t, ok)
+	assert.Equal(t, 9, opts.Level)
+}
+
+func TestGenCompressionStageZstdDefault(t *testing.T) {
+	stage, err := GenCompressionStage(CompressionOptions{Compression: CompressionZstd}, "image.raw")
+	require.NoError(t, err)
+	require.NotNil(t, stage)
+	assert.Equal(t, "org.osbuild.zstd", stage.Type)
+
+	opts, ok := stage.Options.(*ZstdStageOptions)
+	require.True(t, ok)
+	assert.Equal(t, defaultLevel(CompressionZstd), opts.Level)
+}
+
+func TestGenCompressionStageUnknown(t *testing.T) {
+	_, err := GenCompressionStage(CompressionOptions{Compression: "lz4"}, "image.raw")
+	assert.Error(t, err)
+}
+
+func TestGenImageFinalizeStagesAppendsCompression(t *testing.T) {
+	pt := &disk.PartitionTable{}
+
+	stages, err := GenImageFinalizeStages(pt, "image.raw", CompressionOptions{Compression: CompressionZstd})
+	require.NoError(t, err)
+	require.NotEmpty(t, stages)
+
+	last := stages[len(stages)-1]
+	assert.Equal(t, "org.osbuild.zstd", last.Type)
+}
+
+func TestGenImageFinalizeStagesNoneOmitsCompressionStage(t *testing.T) {
+	pt := &disk.PartitionTable{}
+
+	stages, err := GenImageFinalizeStages(pt, "image.raw", CompressionOptions{Compression: CompressionNone})
+	require.NoError(t, err)
+
+	for _, stage := range stages {
+		assert.NotContains(t, []string{"org.osbuild.gzip", "org.osbuild.xz", "org.osbuild.zstd"}, stage.Type)
+	}
+}
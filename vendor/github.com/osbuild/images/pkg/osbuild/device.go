@@ -19,130 +19,497 @@ type DeviceOptions interface {
 	isDeviceOptions()
 }
 
-func GenDeviceCreationStages(pt *disk.PartitionTable, filename string) []*Stage {
+// DeviceStageProvider lets a disk.Entity implementation plug into the device
+// stage generation used by GenDeviceCreationStages, GenDeviceFinishStages,
+// and getDevices without editing the switch statements in this package.
+// Downstream or out-of-tree builds can support additional device classes
+// (dm-integrity, dm-verity, stratis, ...) by implementing this interface and
+// registering it with RegisterDeviceStageProvider from an init() function.
+type DeviceStageProvider interface {
+	// Matches reports whether this provider handles ent.
+	Matches(ent disk.Entity) bool
+
+	// CreationStages returns the stages needed to create the device
+	// represented by ent, along with the devices map those stages were
+	// generated against. path is the chain of entities from the root
+	// partition table down to (and including) ent; filename is the image
+	// file the devices are ultimately backed by.
+	CreationStages(ent disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error)
+
+	// FinishStages returns the stages needed to finish up ent once mounts
+	// and content have been written (e.g. removing a bootstrap LUKS key),
+	// along with the devices map those stages were generated against.
+	FinishStages(ent disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error)
+
+	// FinishOrder returns the relative ordering priority for this
+	// provider's FinishStages output: stages from a provider with a higher
+	// FinishOrder always run after stages from a provider with a lower
+	// one, regardless of traversal order. For example LUKS remove-key
+	// stages must run after LVM metadata-rename stages, since a device
+	// cannot be reopened once its password has changed.
+	FinishOrder() int
+
+	// SelfName returns the name ent is known by when it appears as another
+	// entity's Payload, e.g. the "luks-<uuid>" name a *disk.LUKSContainer
+	// is given by the *disk.Partition that holds it. This is distinct from
+	// DeviceMap's name, which is keyed by ent's own Payload instead.
+	SelfName(ent disk.Entity) string
+
+	// DeviceMap returns the generated device name and the Device used to
+	// reference ent's Payload from ent's own device/loopback. path is the
+	// chain of entities from the root partition table down to (and
+	// including) ent; filename and lockLoopback are forwarded from the
+	// getDevices call that triggered this lookup. DeviceMap returns an error
+	// if ent is misconfigured in a way that would otherwise produce a device
+	// nobody can open, e.g. a LUKS container whose primary keyslot carries
+	// no passphrase.
+	DeviceMap(ent disk.Entity, path []disk.Entity, filename string, parent string, lockLoopback bool) (string, Device, error)
+}
+
+var deviceStageProviders []DeviceStageProvider
+
+// RegisterDeviceStageProvider registers a DeviceStageProvider. Providers are
+// tried in registration order and the last one whose Matches returns true is
+// used, so a downstream registration for a type already handled here takes
+// precedence over the built-in one: this package's own init() always runs
+// before any importing package's, so "last" is the only order a downstream
+// override can reliably claim.
+func RegisterDeviceStageProvider(p DeviceStageProvider) {
+	deviceStageProviders = append(deviceStageProviders, p)
+}
+
+func init() {
+	RegisterDeviceStageProvider(&partitionStageProvider{})
+	RegisterDeviceStageProvider(&luksContainerStageProvider{})
+	RegisterDeviceStageProvider(&lvmVolumeGroupStageProvider{})
+	RegisterDeviceStageProvider(&lvmLogicalVolumeStageProvider{})
+}
+
+func findDeviceStageProvider(ent disk.Entity) DeviceStageProvider {
+	var found DeviceStageProvider
+	for _, p := range deviceStageProviders {
+		if p.Matches(ent) {
+			found = p
+		}
+	}
+	return found
+}
+
+// findPartitionTable walks path (as passed to DeviceMap) backwards for the
+// enclosing *disk.PartitionTable.
+func findPartitionTable(path []disk.Entity) *disk.PartitionTable {
+	for i := len(path) - 1; i >= 0; i-- {
+		if pt, ok := path[i].(*disk.PartitionTable); ok {
+			return pt
+		}
+	}
+	return nil
+}
+
+// partitionStageProvider handles *disk.Partition.
+type partitionStageProvider struct{}
+
+func (partitionStageProvider) Matches(ent disk.Entity) bool {
+	_, ok := ent.(*disk.Partition)
+	return ok
+}
+
+func (partitionStageProvider) CreationStages(e disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error) {
+	// a partition does not need any stage of its own to create; it is
+	// represented purely as a loopback device, set up in DeviceMap
+	return nil, nil, nil
+}
+
+func (partitionStageProvider) FinishStages(e disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error) {
+	return nil, nil, nil
+}
+
+func (partitionStageProvider) FinishOrder() int {
+	return 0
+}
+
+func (partitionStageProvider) SelfName(e disk.Entity) string {
+	// a *disk.Partition is a PartitionTable's slice member, never another
+	// entity's Payload, so it is never looked up this way
+	panic("a partition is never named as a payload; this is a programming error")
+}
+
+func (partitionStageProvider) DeviceMap(e disk.Entity, path []disk.Entity, filename string, parent string, lockLoopback bool) (string, Device, error) {
+	ent := e.(*disk.Partition)
+
+	pt := findPartitionTable(path)
+	if pt == nil {
+		panic("path does not contain partition table; this is a programming error")
+	}
+
+	lbopt := LoopbackDeviceOptions{
+		Filename:   filename,
+		Start:      pt.BytesToSectors(ent.Start),
+		Size:       pt.BytesToSectors(ent.Size),
+		SectorSize: nil,
+		Lock:       lockLoopback,
+	}
+	return deviceName(ent.Payload), *NewLoopbackDevice(&lbopt), nil
+}
+
+// luksContainerStageProvider handles *disk.LUKSContainer.
+type luksContainerStageProvider struct{}
+
+func (luksContainerStageProvider) Matches(ent disk.Entity) bool {
+	_, ok := ent.(*disk.LUKSContainer)
+	return ok
+}
+
+func (luksContainerStageProvider) CreationStages(e disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error) {
+	ent := e.(*disk.LUKSContainer)
 	stages := make([]*Stage, 0)
 
-	genStages := func(e disk.Entity, path []disk.Entity) error {
+	// do not include us when getting the devices
+	stageDevices, lastName, err := getDevices(path[:len(path)-1], filename, true)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		switch ent := e.(type) {
-		case *disk.LUKSContainer:
-			// do not include us when getting the devices
-			stageDevices, lastName := getDevices(path[:len(path)-1], filename, true)
-
-			// "org.osbuild.luks2.format" expects a "device" to create the VG on,
-			// thus rename the last device to "device"
-			lastDevice := stageDevices[lastName]
-			delete(stageDevices, lastName)
-			stageDevices["device"] = lastDevice
-
-			stage := NewLUKS2CreateStage(
-				&LUKS2CreateStageOptions{
-					UUID:       ent.UUID,
-					Passphrase: ent.Passphrase,
-					Cipher:     ent.Cipher,
-					Label:      ent.Label,
-					Subsystem:  ent.Subsystem,
-					SectorSize: ent.SectorSize,
-					PBKDF: Argon2id{
-						Method:      "argon2id",
-						Iterations:  ent.PBKDF.Iterations,
-						Memory:      ent.PBKDF.Memory,
-						Parallelism: ent.PBKDF.Parallelism,
-					},
-				},
-				stageDevices)
-
-			stages = append(stages, stage)
-
-			if ent.Clevis != nil {
-				stages = append(stages, NewClevisLuksBindStage(&ClevisLuksBindStageOptions{
-					Passphrase: ent.Passphrase,
-					Pin:        ent.Clevis.Pin,
-					Policy:     ent.Clevis.Policy,
-				}, stageDevices))
-			}
+	// "org.osbuild.luks2.format" expects a "device" to format,
+	// thus rename the last device to "device"
+	lastDevice := stageDevices[lastName]
+	delete(stageDevices, lastName)
+	stageDevices["device"] = lastDevice
+
+	// ent.Keyslots holds the ordered list of unlock methods enrolled on the
+	// container (passphrase, TPM2, FIDO2, recovery, keyfile). The first
+	// slot is always enrolled by "org.osbuild.luks2.format" itself; any
+	// further slots are enrolled afterwards, one "org.osbuild.luks2.add-key"
+	// stage per slot, authorized with the primary slot's secret.
+	primary, rest, err := splitLUKSKeyslots(ent)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		case *disk.LVMVolumeGroup:
-			// do not include us when getting the devices
-			stageDevices, lastName := getDevices(path[:len(path)-1], filename, true)
-
-			// "org.osbuild.lvm2.create" expects a "device" to create the VG on,
-			// thus rename the last device to "device"
-			lastDevice := stageDevices[lastName]
-			delete(stageDevices, lastName)
-			stageDevices["device"] = lastDevice
-
-			volumes := make([]LogicalVolume, len(ent.LogicalVolumes))
-			for idx, lv := range ent.LogicalVolumes {
-				volumes[idx].Name = lv.Name
-				// NB: we need to specify the size in bytes, since lvcreate
-				// defaults to megabytes
-				volumes[idx].Size = fmt.Sprintf("%dB", lv.Size)
-			}
+	stage := NewLUKS2CreateStage(
+		&LUKS2CreateStageOptions{
+			UUID:       ent.UUID,
+			Passphrase: primary.Passphrase,
+			Cipher:     ent.Cipher,
+			Label:      ent.Label,
+			Subsystem:  ent.Subsystem,
+			SectorSize: ent.SectorSize,
+			PBKDF:      luksKeyslotPBKDF(primary),
+		},
+		stageDevices)
+
+	stages = append(stages, stage)
+
+	if ent.Clevis != nil {
+		stages = append(stages, NewClevisLuksBindStage(&ClevisLuksBindStageOptions{
+			Passphrase: primary.Passphrase,
+			Pin:        ent.Clevis.Pin,
+			Policy:     ent.Clevis.Policy,
+		}, stageDevices))
+	}
 
-			stage := NewLVM2CreateStage(
-				&LVM2CreateStageOptions{
-					Volumes: volumes,
-				}, stageDevices)
+	for _, slot := range rest {
+		stages = append(stages, NewLUKS2AddKeyStage(&LUKS2AddKeyStageOptions{
+			Passphrase:    primary.Passphrase,
+			NewPassphrase: slot.Passphrase,
+			PBKDF:         luksKeyslotPBKDF(slot),
+		}, stageDevices))
+	}
+
+	return stages, stageDevices, nil
+}
+
+// splitLUKSKeyslots returns the primary (format) keyslot and the ordered
+// list of additional keyslots to enroll afterwards. Containers that still
+// use the single ent.Passphrase field (rather than ent.Keyslots) are
+// treated as having one implicit passphrase slot, to keep old disk layouts
+// working unchanged.
+func splitLUKSKeyslots(ent *disk.LUKSContainer) (disk.LUKSKeyslot, []disk.LUKSKeyslot, error) {
+	if len(ent.Keyslots) == 0 {
+		return disk.LUKSKeyslot{Type: "passphrase", Passphrase: ent.Passphrase, PBKDF: ent.PBKDF}, nil, nil
+	}
 
-			stages = append(stages, stage)
+	primary := ent.Keyslots[0]
+	if primary.Passphrase == "" {
+		return disk.LUKSKeyslot{}, nil, fmt.Errorf("the first LUKS keyslot must carry the passphrase used by org.osbuild.luks2.format")
+	}
+
+	return primary, ent.Keyslots[1:], nil
+}
+
+// luksKeyslotPBKDF picks the PBKDF for a keyslot. TPM2/FIDO2-sealed slots
+// are unlocked with a high-entropy secret that is already protected by the
+// sealing mechanism, so they use a cheap KDF; interactively-entered
+// passphrase and recovery-key slots keep the stronger argon2id defaults.
+func luksKeyslotPBKDF(slot disk.LUKSKeyslot) Argon2id {
+	if slot.PBKDF != nil {
+		return Argon2id{
+			Method:      "argon2id",
+			Iterations:  slot.PBKDF.Iterations,
+			Memory:      slot.PBKDF.Memory,
+			Parallelism: slot.PBKDF.Parallelism,
 		}
+	}
 
-		return nil
+	switch slot.Type {
+	case "tpm2", "fido2":
+		return Argon2id{
+			Method:      "argon2id",
+			Iterations:  4,
+			Memory:      32 * 1024,
+			Parallelism: 1,
+		}
+	default:
+		return Argon2id{
+			Method:      "argon2id",
+			Iterations:  1,
+			Memory:      1 * 1024 * 1024,
+			Parallelism: 4,
+		}
+	}
+}
+
+func (luksContainerStageProvider) FinishStages(e disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error) {
+	ent := e.(*disk.LUKSContainer)
+	stages := make([]*Stage, 0)
+
+	// do not include us when getting the devices
+	stageDevices, lastName, err := getDevices(path[:len(path)-1], filename, true)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	_ = pt.ForEachEntity(genStages)
-	return stages
+	lastDevice := stageDevices[lastName]
+	delete(stageDevices, lastName)
+	stageDevices["device"] = lastDevice
+
+	if ent.Clevis != nil && ent.Clevis.RemovePassphrase {
+		primary, _, err := splitLUKSKeyslots(ent)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// additional keyslots (TPM2, FIDO2, recovery, keyfile) are enrolled
+		// before this stage runs, so removing the bootstrap passphrase slot
+		// here leaves every other slot intact.
+		stages = append(stages, NewLUKS2RemoveKeyStage(&LUKS2RemoveKeyStageOptions{
+			Passphrase: primary.Passphrase,
+		}, stageDevices))
+	}
+
+	return stages, stageDevices, nil
 }
 
-func GenDeviceFinishStages(pt *disk.PartitionTable, filename string) []*Stage {
+func (luksContainerStageProvider) FinishOrder() int {
+	// must run after lvmVolumeGroupStageProvider's "org.osbuild.lvm2.metadata"
+	// stage: we cannot open a device if its password has already changed
+	return 10
+}
+
+func (luksContainerStageProvider) SelfName(e disk.Entity) string {
+	ent := e.(*disk.LUKSContainer)
+	return "luks-" + ent.UUID[:4]
+}
+
+func (luksContainerStageProvider) DeviceMap(e disk.Entity, path []disk.Entity, filename string, parent string, lockLoopback bool) (string, Device, error) {
+	ent := e.(*disk.LUKSContainer)
+
+	// the device exposing ent's plaintext content is opened with whichever
+	// keyslot was enrolled first, same as CreationStages/FinishStages, so a
+	// container that only sets Keyslots (no legacy Passphrase) still opens.
+	// A misconfigured primary keyslot (e.g. a TPM2-only slot with no
+	// passphrase) must fail loudly here rather than silently produce a
+	// device nobody can open.
+	primary, _, err := splitLUKSKeyslots(ent)
+	if err != nil {
+		return "", Device{}, err
+	}
+
+	// the device exposing ent's own Payload is keyed by that Payload's
+	// identity, not by ent's own "luks-<uuid>" SelfName
+	lo := LUKS2DeviceOptions{
+		Passphrase: primary.Passphrase,
+	}
+	return deviceName(ent.Payload), *NewLUKS2Device(parent, &lo), nil
+}
+
+// lvmVolumeGroupStageProvider handles *disk.LVMVolumeGroup.
+type lvmVolumeGroupStageProvider struct{}
+
+func (lvmVolumeGroupStageProvider) Matches(ent disk.Entity) bool {
+	_, ok := ent.(*disk.LVMVolumeGroup)
+	return ok
+}
+
+func (lvmVolumeGroupStageProvider) CreationStages(e disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error) {
+	ent := e.(*disk.LVMVolumeGroup)
+
+	// do not include us when getting the devices
+	stageDevices, lastName, err := getDevices(path[:len(path)-1], filename, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// "org.osbuild.lvm2.create" expects a "device" to create the VG on,
+	// thus rename the last device to "device"
+	lastDevice := stageDevices[lastName]
+	delete(stageDevices, lastName)
+	stageDevices["device"] = lastDevice
+
+	volumes := make([]LogicalVolume, len(ent.LogicalVolumes))
+	for idx, lv := range ent.LogicalVolumes {
+		volumes[idx].Name = lv.Name
+		// NB: we need to specify the size in bytes, since lvcreate
+		// defaults to megabytes
+		volumes[idx].Size = fmt.Sprintf("%dB", lv.Size)
+	}
+
+	stage := NewLVM2CreateStage(
+		&LVM2CreateStageOptions{
+			Volumes: volumes,
+		}, stageDevices)
+
+	return []*Stage{stage}, stageDevices, nil
+}
+
+func (lvmVolumeGroupStageProvider) FinishStages(e disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error) {
+	ent := e.(*disk.LVMVolumeGroup)
+
+	// do not include us when getting the devices
+	stageDevices, lastName, err := getDevices(path[:len(path)-1], filename, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// "org.osbuild.lvm2.metadata" expects a "device" to rename the VG,
+	// thus rename the last device to "device"
+	lastDevice := stageDevices[lastName]
+	delete(stageDevices, lastName)
+	stageDevices["device"] = lastDevice
+
+	stage := NewLVM2MetadataStage(
+		&LVM2MetadataStageOptions{
+			VGName: ent.Name,
+		}, stageDevices)
+
+	return []*Stage{stage}, stageDevices, nil
+}
+
+func (lvmVolumeGroupStageProvider) FinishOrder() int {
+	return 0
+}
+
+func (lvmVolumeGroupStageProvider) SelfName(e disk.Entity) string {
+	ent := e.(*disk.LVMVolumeGroup)
+	return ent.Name
+}
+
+func (lvmVolumeGroupStageProvider) DeviceMap(e disk.Entity, path []disk.Entity, filename string, parent string, lockLoopback bool) (string, Device, error) {
+	// LVM volume groups do not get a device node of their own; logical
+	// volumes inside them are addressed directly by name. getDevices skips
+	// calling DeviceMap for *disk.LVMVolumeGroup entirely, so this only
+	// exists to satisfy DeviceStageProvider.
+	ent := e.(*disk.LVMVolumeGroup)
+	return ent.Name, Device{}, nil
+}
+
+// lvmLogicalVolumeStageProvider handles *disk.LVMLogicalVolume. It does not
+// contribute creation/finish stages of its own, since its volume is created
+// as part of the owning LVMVolumeGroup's "org.osbuild.lvm2.create" stage,
+// but it does participate in device naming and mapping.
+type lvmLogicalVolumeStageProvider struct{}
+
+func (lvmLogicalVolumeStageProvider) Matches(ent disk.Entity) bool {
+	_, ok := ent.(*disk.LVMLogicalVolume)
+	return ok
+}
+
+func (lvmLogicalVolumeStageProvider) CreationStages(e disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error) {
+	return nil, nil, nil
+}
+
+func (lvmLogicalVolumeStageProvider) FinishStages(e disk.Entity, path []disk.Entity, filename string) ([]*Stage, map[string]Device, error) {
+	return nil, nil, nil
+}
+
+func (lvmLogicalVolumeStageProvider) FinishOrder() int {
+	return 0
+}
+
+func (lvmLogicalVolumeStageProvider) SelfName(e disk.Entity) string {
+	ent := e.(*disk.LVMLogicalVolume)
+	return ent.Name
+}
+
+func (lvmLogicalVolumeStageProvider) DeviceMap(e disk.Entity, path []disk.Entity, filename string, parent string, lockLoopback bool) (string, Device, error) {
+	ent := e.(*disk.LVMLogicalVolume)
+	lo := LVM2LVDeviceOptions{
+		Volume: ent.Name,
+	}
+	return deviceName(ent.Payload), *NewLVM2LVDevice(parent, &lo), nil
+}
+
+func GenDeviceCreationStages(pt *disk.PartitionTable, filename string) []*Stage {
 	stages := make([]*Stage, 0)
-	removeKeyStages := make([]*Stage, 0)
 
 	genStages := func(e disk.Entity, path []disk.Entity) error {
+		provider := findDeviceStageProvider(e)
+		if provider == nil {
+			return nil
+		}
 
-		switch ent := e.(type) {
-		case *disk.LUKSContainer:
-			// do not include us when getting the devices
-			stageDevices, lastName := getDevices(path[:len(path)-1], filename, true)
+		entStages, _, err := provider.CreationStages(e, path, filename)
+		if err != nil {
+			return err
+		}
+		stages = append(stages, entStages...)
 
-			lastDevice := stageDevices[lastName]
-			delete(stageDevices, lastName)
-			stageDevices["device"] = lastDevice
+		return nil
+	}
 
-			if ent.Clevis != nil {
-				if ent.Clevis.RemovePassphrase {
-					removeKeyStages = append(removeKeyStages, NewLUKS2RemoveKeyStage(&LUKS2RemoveKeyStageOptions{
-						Passphrase: ent.Passphrase,
-					}, stageDevices))
-				}
-			}
-		case *disk.LVMVolumeGroup:
-			// do not include us when getting the devices
-			stageDevices, lastName := getDevices(path[:len(path)-1], filename, true)
+	_ = pt.ForEachEntity(genStages)
+	return stages
+}
 
-			// "org.osbuild.lvm2.metadata" expects a "device" to rename the VG,
-			// thus rename the last device to "device"
-			lastDevice := stageDevices[lastName]
-			delete(stageDevices, lastName)
-			stageDevices["device"] = lastDevice
+func GenDeviceFinishStages(pt *disk.PartitionTable, filename string) []*Stage {
+	type orderedStages struct {
+		order  int
+		stages []*Stage
+	}
+	entries := make([]orderedStages, 0)
 
-			stage := NewLVM2MetadataStage(
-				&LVM2MetadataStageOptions{
-					VGName: ent.Name,
-				}, stageDevices)
+	genStages := func(e disk.Entity, path []disk.Entity) error {
+		provider := findDeviceStageProvider(e)
+		if provider == nil {
+			return nil
+		}
 
-			stages = append(stages, stage)
+		entStages, _, err := provider.FinishStages(e, path, filename)
+		if err != nil {
+			return err
 		}
+		if len(entStages) == 0 {
+			return nil
+		}
+
+		entries = append(entries, orderedStages{order: provider.FinishOrder(), stages: entStages})
 
 		return nil
 	}
 
 	_ = pt.ForEachEntity(genStages)
-	// Ensure that "org.osbuild.luks2.remove-key" stages are done after
-	// "org.osbuild.lvm2.metadata" stages, we cannot open a device if its
-	// password has changed
-	stages = append(stages, removeKeyStages...)
+
+	// stable sort by FinishOrder so e.g. LUKS remove-key stages (order 10)
+	// always land after LVM metadata-rename stages (order 0), regardless of
+	// where in the partition table they were encountered
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].order < entries[j].order
+	})
+
+	stages := make([]*Stage, 0)
+	for _, entry := range entries {
+		stages = append(stages, entry.stages...)
+	}
 	return stages
 }
 
@@ -151,59 +518,43 @@ func deviceName(p disk.Entity) string {
 		panic("device is nil; this is a programming error")
 	}
 
-	switch payload := p.(type) {
-	case disk.Mountable:
-		return pathEscape(payload.GetMountpoint())
-	case *disk.LUKSContainer:
-		return "luks-" + payload.UUID[:4]
-	case *disk.LVMVolumeGroup:
-		return payload.Name
-	case *disk.LVMLogicalVolume:
-		return payload.Name
+	if m, ok := p.(disk.Mountable); ok {
+		return pathEscape(m.GetMountpoint())
 	}
+
+	if provider := findDeviceStageProvider(p); provider != nil {
+		return provider.SelfName(p)
+	}
+
 	panic(fmt.Sprintf("unsupported device type in deviceName: '%T'", p))
 }
 
-func getDevices(path []disk.Entity, filename string, lockLoopback bool) (map[string]Device, string) {
-	var pt *disk.PartitionTable
-
+func getDevices(path []disk.Entity, filename string, lockLoopback bool) (map[string]Device, string, error) {
 	do := make(map[string]Device)
 	parent := ""
-	for _, elem := range path {
-		switch e := elem.(type) {
+	for i, elem := range path {
+		switch elem.(type) {
 		case *disk.PartitionTable:
-			pt = e
-		case *disk.Partition:
-			if pt == nil {
-				panic("path does not contain partition table; this is a programming error")
-			}
-			lbopt := LoopbackDeviceOptions{
-				Filename:   filename,
-				Start:      pt.BytesToSectors(e.Start),
-				Size:       pt.BytesToSectors(e.Size),
-				SectorSize: nil,
-				Lock:       lockLoopback,
-			}
-			name := deviceName(e.Payload)
-			do[name] = *NewLoopbackDevice(&lbopt)
-			parent = name
-		case *disk.LUKSContainer:
-			lo := LUKS2DeviceOptions{
-				Passphrase: e.Passphrase,
-			}
-			name := deviceName(e.Payload)
-			do[name] = *NewLUKS2Device(parent, &lo)
-			parent = name
-		case *disk.LVMLogicalVolume:
-			lo := LVM2LVDeviceOptions{
-				Volume: e.Name,
-			}
-			name := deviceName(e.Payload)
-			do[name] = *NewLVM2LVDevice(parent, &lo)
-			parent = name
+			continue
+		case *disk.LVMVolumeGroup:
+			// volume groups do not have a device node of their own; the
+			// logical volumes inside are addressed against the same parent
+			// device the volume group itself sits on
+			continue
 		}
+
+		provider := findDeviceStageProvider(elem)
+		if provider == nil {
+			continue
+		}
+		name, dev, err := provider.DeviceMap(elem, path[:i+1], filename, parent, lockLoopback)
+		if err != nil {
+			return nil, "", err
+		}
+		do[name] = dev
+		parent = name
 	}
-	return do, parent
+	return do, parent, nil
 }
 
 // pathEscape implements similar path escaping as used by systemd-escape
@@ -230,7 +581,10 @@ func genMountsDevicesFromPt(filename string, pt *disk.PartitionTable) (string, [
 	mounts := make([]Mount, 0, len(pt.Partitions))
 	var fsRootMntName string
 	genMounts := func(mnt disk.Mountable, path []disk.Entity) error {
-		stageDevices, name := getDevices(path, filename, false)
+		stageDevices, name, err := getDevices(path, filename, false)
+		if err != nil {
+			return err
+		}
 		mountpoint := mnt.GetMountpoint()
 
 		if mountpoint == "/" {
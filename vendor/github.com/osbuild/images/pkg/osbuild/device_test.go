@@ -0,0 +1,101 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetDevicesLUKSDirectlyOnPartition is a regression test for the
+// DeviceStageProvider refactor: a *disk.LUKSContainer sitting directly on a
+// *disk.Partition must produce two distinct device entries (the ciphertext
+// loopback, keyed by the container's own identity, and the plaintext LUKS2
+// device, keyed by whatever the container's Payload is), not one
+// self-referential entry.
+func TestGetDevicesLUKSDirectlyOnPartition(t *testing.T) {
+	pt := &disk.PartitionTable{}
+	fs := &disk.Filesystem{Mountpoint: "/", Type: "ext4"}
+	luks := &disk.LUKSContainer{
+		UUID:       "11112222-3333-4444-5555-666677778888",
+		Passphrase: "swordfish",
+		Payload:    fs,
+	}
+	part := &disk.Partition{
+		Start:   0,
+		Size:    1024,
+		Payload: luks,
+	}
+
+	path := []disk.Entity{pt, part, luks}
+	devices, lastName, err := getDevices(path, "disk.img", true)
+	require.NoError(t, err)
+
+	require.Len(t, devices, 2)
+
+	cipherName := "luks-1111"
+	require.Contains(t, devices, cipherName)
+	assert.Empty(t, devices[cipherName].Parent, "the ciphertext loopback device has no parent")
+
+	plainName := "-"
+	require.Contains(t, devices, plainName)
+	assert.Equal(t, cipherName, devices[plainName].Parent, "the plaintext LUKS device must be opened on top of the ciphertext loopback, not on itself")
+	assert.NotEqual(t, plainName, devices[plainName].Parent, "the plaintext LUKS device must not be its own parent")
+
+	assert.Equal(t, plainName, lastName)
+}
+
+// TestGetDevicesLUKSWithLVM covers a LUKS container holding an LVM volume
+// group with one logical volume, asserting that every layer is keyed by
+// its Payload's identity and chained to the previous layer's name.
+func TestGetDevicesLUKSWithLVM(t *testing.T) {
+	pt := &disk.PartitionTable{}
+	fs := &disk.Filesystem{Mountpoint: "/data", Type: "xfs"}
+	lv := &disk.LVMLogicalVolume{Name: "lv00", Size: 2048, Payload: fs}
+	vg := &disk.LVMVolumeGroup{Name: "vg00", LogicalVolumes: []disk.LVMLogicalVolume{*lv}}
+	luks := &disk.LUKSContainer{
+		UUID:       "aaaabbbb-cccc-dddd-eeee-ffff00001111",
+		Passphrase: "swordfish",
+		Payload:    vg,
+	}
+	part := &disk.Partition{Start: 0, Size: 4096, Payload: luks}
+
+	path := []disk.Entity{pt, part, luks, vg, lv}
+	devices, lastName, err := getDevices(path, "disk.img", true)
+	require.NoError(t, err)
+
+	cipherName := "luks-aaaa"
+	require.Contains(t, devices, cipherName)
+	assert.Empty(t, devices[cipherName].Parent)
+
+	require.Contains(t, devices, vg.Name, "the LUKS device must be keyed by its payload (the volume group), not by itself")
+	assert.Equal(t, cipherName, devices[vg.Name].Parent)
+
+	lvName := "data"
+	require.Contains(t, devices, lvName, "the logical volume's device must be keyed by its own payload's mountpoint, not by the LV name")
+	assert.Equal(t, vg.Name, devices[lvName].Parent)
+	assert.NotContains(t, devices, lv.Name, "the LV name itself must not be used as a device key")
+
+	assert.Equal(t, lvName, lastName)
+}
+
+// TestGetDevicesLUKSPrimaryKeyslotWithoutPassphraseErrors is a regression
+// test for luksContainerStageProvider.DeviceMap: a container whose primary
+// (first) keyslot carries no passphrase, e.g. one enrolled TPM2-only, must
+// fail loudly instead of silently opening the device with an empty
+// passphrase nobody configured.
+func TestGetDevicesLUKSPrimaryKeyslotWithoutPassphraseErrors(t *testing.T) {
+	pt := &disk.PartitionTable{}
+	fs := &disk.Filesystem{Mountpoint: "/", Type: "ext4"}
+	luks := &disk.LUKSContainer{
+		UUID:     "11112222-3333-4444-5555-666677778888",
+		Keyslots: []disk.LUKSKeyslot{{Type: "tpm2"}},
+		Payload:  fs,
+	}
+	part := &disk.Partition{Start: 0, Size: 1024, Payload: luks}
+
+	path := []disk.Entity{pt, part, luks}
+	_, _, err := getDevices(path, "disk.img", true)
+	assert.Error(t, err)
+}
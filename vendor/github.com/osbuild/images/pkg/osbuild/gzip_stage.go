@@ -0,0 +1,22 @@
+package osbuild
+
+// GzipStageOptions describes the options for the "org.osbuild.gzip" stage,
+// which compresses a file with gzip.
+type GzipStageOptions struct {
+	// Filename of the gzip archive to create.
+	Filename string `json:"filename"`
+
+	// Level is the compression level, 1 (fastest) to 9 (smallest). Leave
+	// unset to use gzip's own default.
+	Level int `json:"level,omitempty"`
+}
+
+func (GzipStageOptions) isStageOptions() {}
+
+// NewGzipStage creates a new Stage for the "org.osbuild.gzip" stage.
+func NewGzipStage(options *GzipStageOptions) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.gzip",
+		Options: options,
+	}
+}
@@ -0,0 +1,29 @@
+package osbuild
+
+// LUKS2AddKeyStageOptions describes the options for the
+// "org.osbuild.luks2.add-key" stage, which enrolls an additional keyslot
+// into an already-formatted LUKS2 container.
+type LUKS2AddKeyStageOptions struct {
+	// Passphrase unlocking one of the container's existing keyslots, used
+	// to authorize enrolling the new one.
+	Passphrase string `json:"passphrase"`
+
+	// NewPassphrase is the secret enrolled into the new keyslot.
+	NewPassphrase string `json:"new_passphrase"`
+
+	// PBKDF configures the key derivation function used for the new
+	// keyslot.
+	PBKDF Argon2id `json:"pbkdf,omitempty"`
+}
+
+func (LUKS2AddKeyStageOptions) isStageOptions() {}
+
+// NewLUKS2AddKeyStage creates a new Stage for the "org.osbuild.luks2.add-key"
+// stage.
+func NewLUKS2AddKeyStage(options *LUKS2AddKeyStageOptions, devices map[string]Device) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.luks2.add-key",
+		Options: options,
+		Devices: devices,
+	}
+}
@@ -0,0 +1,23 @@
+package osbuild
+
+// XzStageOptions describes the options for the "org.osbuild.xz" stage,
+// which compresses a file with xz.
+type XzStageOptions struct {
+	// Filename of the xz archive to create.
+	Filename string `json:"filename"`
+
+	// Level is the compression level, 1 (fastest) to 9 (smallest). Leave
+	// unset to use xz's own default; a zero value is omitted from the
+	// stage options, so xz's level 0 cannot be selected here.
+	Level int `json:"level,omitempty"`
+}
+
+func (XzStageOptions) isStageOptions() {}
+
+// NewXzStage creates a new Stage for the "org.osbuild.xz" stage.
+func NewXzStage(options *XzStageOptions) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.xz",
+		Options: options,
+	}
+}
@@ -0,0 +1,26 @@
+package osbuild
+
+// ZstdStageOptions describes the options for the "org.osbuild.zstd" stage,
+// which compresses a file with zstd.
+type ZstdStageOptions struct {
+	// Filename of the zstd archive to create.
+	Filename string `json:"filename"`
+
+	// Level is the compression level, 1 (fastest) to 19 (smallest). Leave
+	// unset to use zstd's own default.
+	Level int `json:"level,omitempty"`
+
+	// Threads is the number of compression threads. Leave unset to let the
+	// stage pick a thread count from the build host's CPU count.
+	Threads int `json:"threads,omitempty"`
+}
+
+func (ZstdStageOptions) isStageOptions() {}
+
+// NewZstdStage creates a new Stage for the "org.osbuild.zstd" stage.
+func NewZstdStage(options *ZstdStageOptions) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.zstd",
+		Options: options,
+	}
+}